@@ -0,0 +1,23 @@
+package main
+
+import "github.com/moby/buildkit/client/llb"
+
+// archConstraint maps a JobSpec.Architectures entry to the llb.ConstraintsOpt
+// that pins the graph to that platform. Targets the buildkit worker can't
+// run natively are expected to be served via its QEMU emulators (registered
+// with the worker through binfmt_misc), not anything client-side.
+var archConstraint = map[string]llb.ConstraintsOpt{
+	"amd64":   llb.LinuxAmd64,
+	"arm64":   llb.LinuxArm64,
+	"ppc64le": llb.LinuxPpc64le,
+	"s390x":   llb.LinuxS390x,
+}
+
+// archs returns spec.Architectures, defaulting to amd64 alone for specs that
+// haven't opted into the build matrix.
+func (spec JobSpec) archs() []string {
+	if len(spec.Architectures) == 0 {
+		return []string{"amd64"}
+	}
+	return spec.Architectures
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJobSpecArchs(t *testing.T) {
+	cases := []struct {
+		name string
+		spec JobSpec
+		want []string
+	}{
+		{
+			name: "defaults to amd64",
+			spec: JobSpec{},
+			want: []string{"amd64"},
+		},
+		{
+			name: "explicit single arch",
+			spec: JobSpec{Architectures: []string{"arm64"}},
+			want: []string{"arm64"},
+		},
+		{
+			name: "explicit matrix passes through",
+			spec: JobSpec{Architectures: []string{"amd64", "arm64", "ppc64le", "s390x"}},
+			want: []string{"amd64", "arm64", "ppc64le", "s390x"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.spec.archs()
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("archs() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/sync/errgroup"
+)
+
+// SinkKind selects which ArtifactSink implementation a SinkRef resolves to.
+type SinkKind string
+
+const (
+	SinkS3      SinkKind = "s3"
+	SinkHTTP    SinkKind = "http"
+	SinkDNFRepo SinkKind = "dnfrepo"
+)
+
+// SinkRef names an artifact destination plus the connection details its
+// ArtifactSink needs.
+type SinkRef struct {
+	Kind SinkKind `json:"kind"`
+
+	// Endpoint is the S3 endpoint, HTTP(S)/WebDAV base URL, or local repo
+	// root, depending on Kind.
+	Endpoint string `json:"endpoint"`
+
+	// Bucket is the S3 bucket name. Only used when Kind is SinkS3.
+	Bucket string `json:"bucket,omitempty"`
+
+	// Prefix is prepended to each artifact's path at the destination.
+	Prefix string `json:"prefix,omitempty"`
+
+	// CredentialID names a secret registered via RegisterSecret holding
+	// this sink's access credentials (an "id:secret" pair for SinkS3, or
+	// "user:password" for SinkHTTP). Unused for SinkDNFRepo.
+	CredentialID string `json:"credentialId,omitempty"`
+}
+
+// Artifact is a single built file staged for replication, e.g. an RPM
+// exported from the /out mount of a finished build.
+type Artifact struct {
+	Name string
+	Data []byte
+}
+
+// ArtifactSink publishes a built artifact to a destination repository.
+type ArtifactSink interface {
+	Publish(ctx context.Context, artifact Artifact) error
+}
+
+// NewArtifactSink resolves ref to a concrete ArtifactSink, looking up its
+// credentials (if any) from b's secret store.
+func (b *BuilderService) NewArtifactSink(ref SinkRef) (ArtifactSink, error) {
+	var credential string
+	if ref.CredentialID != "" {
+		v, ok := b.secret(ref.CredentialID)
+		if !ok {
+			return nil, fmt.Errorf("sink %s: credential %q was not registered", ref.Endpoint, ref.CredentialID)
+		}
+		credential = v
+	}
+
+	switch ref.Kind {
+	case SinkS3:
+		return newS3Sink(ref, credential)
+	case SinkHTTP:
+		return &httpSink{baseURL: ref.Endpoint, prefix: ref.Prefix, credential: credential}, nil
+	case SinkDNFRepo:
+		return &dnfRepoSink{root: ref.Endpoint}, nil
+	default:
+		return nil, fmt.Errorf("sink %s: unsupported kind %q", ref.Endpoint, ref.Kind)
+	}
+}
+
+// publishArtifacts exports the RPMs staged in outDir to every sink in
+// spec.Sinks concurrently, emitting a status frame per artifact/sink pair.
+// artifactGlobs is the .anda.yml `artifacts` map (glob -> upload path); when
+// non-empty it selects and renames what gets published instead of every
+// file under outDir.
+func (b *BuilderService) publishArtifacts(ctx context.Context, spec JobSpec, jobID, outDir string, artifactGlobs map[string]string, listener BuildListener) error {
+	if len(spec.Sinks) == 0 {
+		return nil
+	}
+
+	artifacts, err := collectArtifacts(outDir, artifactGlobs)
+	if err != nil {
+		return fmt.Errorf("job %s: collect artifacts: %w", jobID, err)
+	}
+
+	sinks := make([]ArtifactSink, 0, len(spec.Sinks))
+	for _, ref := range spec.Sinks {
+		sink, err := b.NewArtifactSink(ref)
+		if err != nil {
+			return fmt.Errorf("job %s: %w", jobID, err)
+		}
+		sinks = append(sinks, sink)
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	for _, sink := range sinks {
+		sink := sink
+		for _, artifact := range artifacts {
+			artifact := artifact
+			g.Go(func() error {
+				err := sink.Publish(gctx, artifact)
+				listener.OnArtifactPublished(jobID, artifact.Name, err)
+				return err
+			})
+		}
+	}
+
+	return g.Wait()
+}
+
+// collectArtifacts reads files under dir into Artifacts, named by their path
+// relative to dir. When globs is non-empty (an .anda.yml `artifacts` map),
+// only files matching one of its glob keys are collected, renamed under the
+// matching value as a destination prefix; otherwise every regular file
+// under dir is collected as-is.
+func collectArtifacts(dir string, globs map[string]string) ([]Artifact, error) {
+	var artifacts []Artifact
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		name := rel
+		if len(globs) > 0 {
+			dest, ok, err := matchArtifactGlob(globs, rel)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+			name = filepath.Join(dest, filepath.Base(rel))
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		artifacts = append(artifacts, Artifact{Name: name, Data: data})
+		return nil
+	})
+
+	return artifacts, err
+}
+
+// matchArtifactGlob returns the destination globs maps rel's first matching
+// glob key to, or ok=false if rel matches none of them.
+func matchArtifactGlob(globs map[string]string, rel string) (string, bool, error) {
+	for glob, dest := range globs {
+		matched, err := filepath.Match(glob, rel)
+		if err != nil {
+			return "", false, fmt.Errorf("artifact glob %q: %w", glob, err)
+		}
+		if matched {
+			return dest, true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+// s3Sink publishes artifacts to an S3-compatible object store.
+type s3Sink struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func newS3Sink(ref SinkRef, credential string) (*s3Sink, error) {
+	accessKeyID, secretAccessKey, ok := strings.Cut(credential, ":")
+	if !ok {
+		return nil, fmt.Errorf("sink %s: credential must be an \"id:secret\" pair", ref.Endpoint)
+	}
+
+	client := s3.New(s3.Options{
+		BaseEndpoint: aws.String(ref.Endpoint),
+		Credentials:  credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, ""),
+	})
+
+	return &s3Sink{client: client, bucket: ref.Bucket, prefix: ref.Prefix}, nil
+}
+
+func (s *s3Sink) Publish(ctx context.Context, artifact Artifact) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(filepath.Join(s.prefix, artifact.Name)),
+		Body:   bytes.NewReader(artifact.Data),
+	})
+	if err != nil {
+		return fmt.Errorf("s3 put %s: %w", artifact.Name, err)
+	}
+
+	return nil
+}
+
+// httpSink publishes artifacts via a plain HTTP PUT / WebDAV request.
+type httpSink struct {
+	baseURL    string
+	prefix     string
+	credential string
+}
+
+func (s *httpSink) Publish(ctx context.Context, artifact Artifact) error {
+	url := strings.TrimRight(s.baseURL, "/") + "/" + filepath.Join(s.prefix, artifact.Name)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(artifact.Data))
+	if err != nil {
+		return fmt.Errorf("http put %s: %w", artifact.Name, err)
+	}
+
+	if user, pass, ok := strings.Cut(s.credential, ":"); ok {
+		req.SetBasicAuth(user, pass)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http put %s: %w", artifact.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("http put %s: unexpected status %s", artifact.Name, resp.Status)
+	}
+
+	return nil
+}
+
+// dnfRepoSink publishes artifacts into a createrepo_c-backed dnf repo rooted
+// at a local or network-mounted directory, refreshing its metadata after
+// every write. publishArtifacts fans writes out concurrently across sinks,
+// but createrepo_c --update is not safe to run concurrently against the
+// same repo root, so every Publish on one sink is serialized behind mu.
+type dnfRepoSink struct {
+	root string
+
+	mu sync.Mutex
+}
+
+func (s *dnfRepoSink) Publish(ctx context.Context, artifact Artifact) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dest := filepath.Join(s.root, artifact.Name)
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("dnfrepo %s: %w", artifact.Name, err)
+	}
+
+	if err := os.WriteFile(dest, artifact.Data, 0o644); err != nil {
+		return fmt.Errorf("dnfrepo %s: %w", artifact.Name, err)
+	}
+
+	cmd := exec.CommandContext(ctx, "createrepo_c", "--update", s.root)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("dnfrepo %s: createrepo_c --update: %w: %s", artifact.Name, err, out)
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewArtifactSinkDispatch(t *testing.T) {
+	b := &BuilderService{}
+	if err := b.RegisterSecret("s3-cred", "AKIAEXAMPLE:secretkey"); err != nil {
+		t.Fatalf("RegisterSecret: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		ref     SinkRef
+		want    any
+		wantErr bool
+	}{
+		{name: "s3", ref: SinkRef{Kind: SinkS3, CredentialID: "s3-cred"}, want: &s3Sink{}},
+		{name: "http", ref: SinkRef{Kind: SinkHTTP, Endpoint: "https://repo.example/"}, want: &httpSink{}},
+		{name: "dnfrepo", ref: SinkRef{Kind: SinkDNFRepo, Endpoint: "/srv/repo"}, want: &dnfRepoSink{}},
+		{name: "unsupported kind", ref: SinkRef{Kind: "bogus"}, wantErr: true},
+		{name: "missing credential", ref: SinkRef{Kind: SinkS3, CredentialID: "missing"}, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sink, err := b.NewArtifactSink(tc.ref)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("NewArtifactSink: want error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewArtifactSink: %v", err)
+			}
+
+			switch tc.want.(type) {
+			case *s3Sink:
+				if _, ok := sink.(*s3Sink); !ok {
+					t.Fatalf("NewArtifactSink = %T, want *s3Sink", sink)
+				}
+			case *httpSink:
+				if _, ok := sink.(*httpSink); !ok {
+					t.Fatalf("NewArtifactSink = %T, want *httpSink", sink)
+				}
+			case *dnfRepoSink:
+				if _, ok := sink.(*dnfRepoSink); !ok {
+					t.Fatalf("NewArtifactSink = %T, want *dnfRepoSink", sink)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchArtifactGlob(t *testing.T) {
+	globs := map[string]string{
+		"*.rpm":      "rpms/",
+		"*.src.rpm*": "srpms/",
+	}
+
+	dest, ok, err := matchArtifactGlob(globs, "foo-1.0.rpm")
+	if err != nil {
+		t.Fatalf("matchArtifactGlob: %v", err)
+	}
+	if !ok || dest != "rpms/" {
+		t.Fatalf("matchArtifactGlob(foo-1.0.rpm) = %q, %v, want %q, true", dest, ok, "rpms/")
+	}
+
+	_, ok, err = matchArtifactGlob(globs, "notes.txt")
+	if err != nil {
+		t.Fatalf("matchArtifactGlob: %v", err)
+	}
+	if ok {
+		t.Fatal("matchArtifactGlob(notes.txt) = true, want false")
+	}
+}
+
+func TestCollectArtifactsFiltersAndRenames(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "foo-1.0.rpm"), []byte("rpm-data"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "build.log"), []byte("log-data"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	artifacts, err := collectArtifacts(dir, map[string]string{"*.rpm": "rpms"})
+	if err != nil {
+		t.Fatalf("collectArtifacts: %v", err)
+	}
+
+	if len(artifacts) != 1 {
+		t.Fatalf("collectArtifacts returned %d artifacts, want 1", len(artifacts))
+	}
+	if want := filepath.Join("rpms", "foo-1.0.rpm"); artifacts[0].Name != want {
+		t.Errorf("collectArtifacts name = %q, want %q", artifacts[0].Name, want)
+	}
+}
+
+func TestCollectArtifactsNoGlobsCollectsEverything(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "foo-1.0.rpm"), []byte("rpm-data"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "build.log"), []byte("log-data"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	artifacts, err := collectArtifacts(dir, nil)
+	if err != nil {
+		t.Fatalf("collectArtifacts: %v", err)
+	}
+	if len(artifacts) != 2 {
+		t.Fatalf("collectArtifacts returned %d artifacts, want 2", len(artifacts))
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sync"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/secrets/secretsprovider"
+	"github.com/moby/buildkit/session/sshforward/sshprovider"
+)
+
+// Auth describes how to authenticate the llb.Git source for a JobSpec.
+// Exactly one field should be set: Token and Basic name a secret registered
+// via RegisterSecret; SSHKeyID forwards a local SSH agent socket instead.
+type Auth struct {
+	// Token is a secret ID holding an HTTP auth token (GITHUB_TOKEN-style).
+	Token string `json:"token,omitempty"`
+
+	// Basic is a secret ID holding a "user:password" pair for HTTP basic
+	// auth; it is base64-encoded into a "Basic ..." Authorization header
+	// before being forwarded to BuildKit.
+	Basic string `json:"basic,omitempty"`
+
+	// SSHKeyID is a secret ID holding the path to a local SSH agent socket
+	// (or key), forwarded by BuildKit via llb.MountSSHSock for git+ssh://
+	// clones.
+	SSHKeyID string `json:"sshKeyId,omitempty"`
+}
+
+// gitOptions translates spec.Auth into the llb.GitOption values llb.Git(...)
+// needs to authenticate the clone.
+func (spec JobSpec) gitOptions() []llb.GitOption {
+	if spec.Auth == nil {
+		return nil
+	}
+
+	switch {
+	case spec.Auth.Token != "":
+		return []llb.GitOption{llb.AuthTokenSecret(spec.Auth.Token)}
+	case spec.Auth.Basic != "":
+		return []llb.GitOption{llb.AuthHeaderSecret(spec.Auth.Basic)}
+	case spec.Auth.SSHKeyID != "":
+		return []llb.GitOption{llb.MountSSHSock(spec.Auth.SSHKeyID)}
+	default:
+		return nil
+	}
+}
+
+// secretStore holds credentials registered via RegisterSecret, keyed by the
+// ID a JobSpec.Auth field references, so callers can push credentials once
+// and reference them by ID from subsequent JobSpecs instead of embedding
+// secrets in every request payload.
+type secretStore struct {
+	mu      sync.RWMutex
+	secrets map[string]string
+}
+
+// RegisterSecret stores value under id for later JobSpecs to reference.
+func (b *BuilderService) RegisterSecret(id, value string) error {
+	if id == "" {
+		return fmt.Errorf("register secret: id must not be empty")
+	}
+
+	b.secrets.mu.Lock()
+	defer b.secrets.mu.Unlock()
+
+	if b.secrets.secrets == nil {
+		b.secrets.secrets = make(map[string]string)
+	}
+	b.secrets.secrets[id] = value
+
+	return nil
+}
+
+// secret looks up a previously registered credential by ID.
+func (b *BuilderService) secret(id string) (string, bool) {
+	b.secrets.mu.RLock()
+	defer b.secrets.mu.RUnlock()
+
+	v, ok := b.secrets.secrets[id]
+	return v, ok
+}
+
+// sessionAttachables builds the BuildKit session attachments needed to
+// resolve spec.Auth's secret ID at solve time.
+func (b *BuilderService) sessionAttachables(spec JobSpec) ([]session.Attachable, error) {
+	if spec.Auth == nil {
+		return nil, nil
+	}
+
+	switch {
+	case spec.Auth.Token != "":
+		value, ok := b.secret(spec.Auth.Token)
+		if !ok {
+			return nil, fmt.Errorf("job %s: secret %q was not registered", spec.ID, spec.Auth.Token)
+		}
+
+		return []session.Attachable{secretsprovider.FromMap(map[string][]byte{
+			spec.Auth.Token: []byte(value),
+		})}, nil
+
+	case spec.Auth.Basic != "":
+		value, ok := b.secret(spec.Auth.Basic)
+		if !ok {
+			return nil, fmt.Errorf("job %s: secret %q was not registered", spec.ID, spec.Auth.Basic)
+		}
+
+		header := "Basic " + base64.StdEncoding.EncodeToString([]byte(value))
+		return []session.Attachable{secretsprovider.FromMap(map[string][]byte{
+			spec.Auth.Basic: []byte(header),
+		})}, nil
+
+	case spec.Auth.SSHKeyID != "":
+		sockPath, ok := b.secret(spec.Auth.SSHKeyID)
+		if !ok {
+			return nil, fmt.Errorf("job %s: secret %q was not registered", spec.ID, spec.Auth.SSHKeyID)
+		}
+
+		agent, err := sshprovider.NewSSHAgentProvider([]sshprovider.AgentConfig{
+			{ID: spec.Auth.SSHKeyID, Paths: []string{sockPath}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("job %s: ssh agent %q: %w", spec.ID, spec.Auth.SSHKeyID, err)
+		}
+
+		return []session.Attachable{agent}, nil
+
+	default:
+		return nil, nil
+	}
+}
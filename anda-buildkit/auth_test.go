@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestJobSpecGitOptions(t *testing.T) {
+	cases := []struct {
+		name string
+		spec JobSpec
+		want int
+	}{
+		{name: "nil auth", spec: JobSpec{}, want: 0},
+		{name: "token", spec: JobSpec{Auth: &Auth{Token: "gh-token"}}, want: 1},
+		{name: "basic", spec: JobSpec{Auth: &Auth{Basic: "gh-basic"}}, want: 1},
+		{name: "ssh", spec: JobSpec{Auth: &Auth{SSHKeyID: "gh-ssh"}}, want: 1},
+		{name: "empty auth", spec: JobSpec{Auth: &Auth{}}, want: 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.spec.gitOptions()
+			if len(got) != tc.want {
+				t.Errorf("gitOptions() returned %d options, want %d", len(got), tc.want)
+			}
+		})
+	}
+}
+
+func TestSecretStoreRegisterAndLookup(t *testing.T) {
+	b := &BuilderService{}
+
+	if err := b.RegisterSecret("", "value"); err == nil {
+		t.Fatal("RegisterSecret with empty id: want error, got nil")
+	}
+
+	if err := b.RegisterSecret("gh-token", "s3cr3t"); err != nil {
+		t.Fatalf("RegisterSecret: %v", err)
+	}
+
+	v, ok := b.secret("gh-token")
+	if !ok || v != "s3cr3t" {
+		t.Fatalf("secret(%q) = %q, %v, want %q, true", "gh-token", v, ok, "s3cr3t")
+	}
+
+	if _, ok := b.secret("missing"); ok {
+		t.Fatal("secret(\"missing\") = _, true, want false")
+	}
+}
+
+func TestSessionAttachablesUnregisteredSecret(t *testing.T) {
+	b := &BuilderService{}
+	spec := JobSpec{ID: "job-1", Auth: &Auth{Token: "gh-token"}}
+
+	if _, err := b.sessionAttachables(spec); err == nil {
+		t.Fatal("sessionAttachables with unregistered secret: want error, got nil")
+	}
+}
+
+func TestSessionAttachablesNilAuth(t *testing.T) {
+	b := &BuilderService{}
+
+	attachables, err := b.sessionAttachables(JobSpec{ID: "job-1"})
+	if err != nil {
+		t.Fatalf("sessionAttachables: %v", err)
+	}
+	if attachables != nil {
+		t.Fatalf("sessionAttachables with nil auth = %v, want nil", attachables)
+	}
+}
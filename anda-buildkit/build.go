@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/client/llb"
+)
+
+// BuildListener receives progress events for a single Build call, mirroring
+// the distbuild client's per-job callback shape.
+type BuildListener interface {
+	OnJobStdout(jobID string, chunk []byte)
+	OnJobStderr(jobID string, chunk []byte)
+	OnJobFinished(jobID string)
+	OnJobFailed(jobID string, code int, err error)
+	OnArtifactPublished(jobID string, artifact string, err error)
+}
+
+// BuildStatusKind identifies the payload carried by a BuildStatusFrame.
+type BuildStatusKind string
+
+const (
+	BuildStatusStdout   BuildStatusKind = "stdout"
+	BuildStatusStderr   BuildStatusKind = "stderr"
+	BuildStatusFinished BuildStatusKind = "finished"
+	BuildStatusFailed   BuildStatusKind = "failed"
+	BuildStatusArtifact BuildStatusKind = "artifact"
+)
+
+// BuildStatusFrame is the wire shape emitted on the builder_subscribeBuild
+// subscription, decoded from BuildKit's StatusResponse/VertexLog stream.
+type BuildStatusFrame struct {
+	JobID    string          `json:"jobId"`
+	Kind     BuildStatusKind `json:"kind"`
+	Data     []byte          `json:"data,omitempty"`
+	Code     int             `json:"code,omitempty"`
+	Err      string          `json:"err,omitempty"`
+	Artifact string          `json:"artifact,omitempty"`
+}
+
+// Build dispatches one LLB graph per entry in the resolved architecture
+// matrix to the buildkitd endpoint named by spec.BuildkitAddr, forwarding
+// progress to listener as BuildKit reports it. Architectures build
+// independently and concurrently, so a failure on one (e.g. arm64) does not
+// cancel or block the others; the result is keyed by arch.
+func (b *BuilderService) Build(ctx context.Context, spec JobSpec, listener BuildListener) map[string]error {
+	p, err := b.plan(ctx, spec)
+	if err != nil {
+		archs := spec.archs()
+		errs := make(map[string]error, len(archs))
+		for _, arch := range archs {
+			errs[arch] = err
+		}
+		return errs
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs = make(map[string]error, len(p.archs))
+	)
+
+	for _, arch := range p.archs {
+		wg.Add(1)
+		go func(arch string) {
+			defer wg.Done()
+			err := b.buildArch(ctx, spec, arch, p.state, p.artifacts, listener)
+
+			mu.Lock()
+			errs[arch] = err
+			mu.Unlock()
+		}(arch)
+	}
+
+	wg.Wait()
+	return errs
+}
+
+// buildArch solves state for a single arch, reporting progress to listener
+// under a jobID of "<spec.ID>-<arch>" so per-arch status frames are
+// distinguishable on the build subscription. artifactGlobs is the
+// .anda.yml `artifacts` map (glob -> upload path), or nil for the fixed
+// pipeline, and filters/renames what publishArtifacts replicates.
+func (b *BuilderService) buildArch(ctx context.Context, spec JobSpec, arch string, state llb.State, artifactGlobs map[string]string, listener BuildListener) error {
+	jobID := fmt.Sprintf("%s-%s", spec.ID, arch)
+
+	opt, ok := archConstraint[arch]
+	if !ok {
+		err := fmt.Errorf("unsupported architecture %q", arch)
+		listener.OnJobFailed(jobID, 1, err)
+		return err
+	}
+
+	def, err := state.Marshal(ctx, opt)
+	if err != nil {
+		err = fmt.Errorf("marshal job %s: %w", jobID, err)
+		listener.OnJobFailed(jobID, 1, err)
+		return err
+	}
+
+	bkClient, err := client.New(ctx, spec.BuildkitAddr)
+	if err != nil {
+		err = fmt.Errorf("dial buildkitd at %q: %w", spec.BuildkitAddr, err)
+		listener.OnJobFailed(jobID, 1, err)
+		return err
+	}
+	defer bkClient.Close()
+
+	attachables, err := b.sessionAttachables(spec)
+	if err != nil {
+		listener.OnJobFailed(jobID, 1, err)
+		return err
+	}
+
+	outDir, err := os.MkdirTemp("", "anda-build-*")
+	if err != nil {
+		listener.OnJobFailed(jobID, 1, err)
+		return err
+	}
+	defer os.RemoveAll(outDir)
+
+	solveOpt := client.SolveOpt{
+		Session: attachables,
+		Exports: []client.ExportEntry{{Type: client.ExporterLocal, OutputDir: outDir}},
+	}
+
+	statusCh := make(chan *client.SolveStatus)
+	go b.relayStatus(jobID, statusCh, listener)
+
+	if _, err := bkClient.Solve(ctx, def, solveOpt, statusCh); err != nil {
+		err = fmt.Errorf("solve job %s: %w", jobID, err)
+		listener.OnJobFailed(jobID, 1, err)
+		return err
+	}
+
+	listener.OnJobFinished(jobID)
+
+	if err := b.publishArtifacts(ctx, spec, jobID, outDir, artifactGlobs, listener); err != nil {
+		return fmt.Errorf("publish artifacts for job %s: %w", jobID, err)
+	}
+
+	return nil
+}
+
+// relayStatus drains a BuildKit status channel, translating VertexLog output
+// and vertex errors into BuildListener callbacks until the channel closes.
+func (b *BuilderService) relayStatus(jobID string, statusCh <-chan *client.SolveStatus, listener BuildListener) {
+	for st := range statusCh {
+		for _, v := range st.Vertexes {
+			if v.Error != "" {
+				listener.OnJobFailed(jobID, 1, fmt.Errorf("%s", v.Error))
+			}
+		}
+		for _, l := range st.Logs {
+			if l.Stream == 2 {
+				listener.OnJobStderr(jobID, l.Data)
+			} else {
+				listener.OnJobStdout(jobID, l.Data)
+			}
+		}
+	}
+}
+
+// SubscribeBuild implements the builder_subscribeBuild RPC subscription: it
+// runs Build for spec and streams a BuildStatusFrame per event to the caller
+// until the job finishes, fails, or the subscriber unsubscribes.
+func (b *BuilderService) SubscribeBuild(ctx context.Context, spec JobSpec) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	sub := notifier.CreateSubscription()
+
+	go func() {
+		listener := &subscriptionListener{notifier: notifier, sub: sub}
+		b.Build(ctx, spec, listener)
+	}()
+
+	return sub, nil
+}
+
+// subscriptionListener adapts BuildListener callbacks onto a go-ethereum
+// rpc.Subscription, encoding each event as a BuildStatusFrame.
+type subscriptionListener struct {
+	notifier *rpc.Notifier
+	sub      *rpc.Subscription
+}
+
+func (l *subscriptionListener) OnJobStdout(jobID string, chunk []byte) {
+	l.notifier.Notify(l.sub.ID, BuildStatusFrame{JobID: jobID, Kind: BuildStatusStdout, Data: chunk})
+}
+
+func (l *subscriptionListener) OnJobStderr(jobID string, chunk []byte) {
+	l.notifier.Notify(l.sub.ID, BuildStatusFrame{JobID: jobID, Kind: BuildStatusStderr, Data: chunk})
+}
+
+func (l *subscriptionListener) OnJobFinished(jobID string) {
+	l.notifier.Notify(l.sub.ID, BuildStatusFrame{JobID: jobID, Kind: BuildStatusFinished})
+}
+
+func (l *subscriptionListener) OnJobFailed(jobID string, code int, err error) {
+	l.notifier.Notify(l.sub.ID, BuildStatusFrame{JobID: jobID, Kind: BuildStatusFailed, Code: code, Err: err.Error()})
+}
+
+func (l *subscriptionListener) OnArtifactPublished(jobID string, artifact string, err error) {
+	frame := BuildStatusFrame{JobID: jobID, Kind: BuildStatusArtifact, Artifact: artifact}
+	if err != nil {
+		frame.Err = err.Error()
+	}
+	l.notifier.Notify(l.sub.ID, frame)
+}
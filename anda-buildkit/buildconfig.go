@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/client/llb"
+	"gopkg.in/yaml.v3"
+)
+
+// BuildConfig is the decoded shape of an .anda.yml checked into a package
+// repo, describing how to turn its sources into RPMs.
+type BuildConfig struct {
+	SpecFile      string            `yaml:"spec_file"`
+	BuilddepRepos []string          `yaml:"builddep_repos"`
+	Pre           []string          `yaml:"pre"`
+	Post          []string          `yaml:"post"`
+	Patches       []string          `yaml:"patches"`
+	Sources       []string          `yaml:"sources"`
+	Macros        map[string]string `yaml:"macros"`
+	ArchMatrix    []string          `yaml:"arch_matrix"`
+	Artifacts     map[string]string `yaml:"artifacts"`
+}
+
+// LoadFromFile reads and parses the .anda.yml build spec at path, which must
+// already be present on the local filesystem (e.g. an export BuildKit wrote
+// there). It does not itself reach into a remote repo; see LoadFromRepo.
+func LoadFromFile(path string) (*BuildConfig, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read build config %q: %w", path, err)
+	}
+
+	var cfg BuildConfig
+	if err := yaml.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("parse build config %q: %w", path, err)
+	}
+
+	if cfg.SpecFile == "" {
+		return nil, fmt.Errorf("build config %q: spec_file is required", path)
+	}
+
+	return &cfg, nil
+}
+
+// LoadFromRepo resolves and parses configPath inside the git repo described
+// by spec. The repo only ever materializes inside the LLB graph on the
+// buildkitd worker, so this solves a minimal graph that clones it and
+// exports the result locally, then reads configPath out of that export.
+func (b *BuilderService) LoadFromRepo(ctx context.Context, spec JobSpec, configPath string) (*BuildConfig, error) {
+	bkClient, err := client.New(ctx, spec.BuildkitAddr)
+	if err != nil {
+		return nil, fmt.Errorf("dial buildkitd at %q: %w", spec.BuildkitAddr, err)
+	}
+	defer bkClient.Close()
+
+	def, err := llb.Git(spec.Repo, spec.Ref, spec.gitOptions()...).Marshal(ctx, llb.LinuxAmd64)
+	if err != nil {
+		return nil, fmt.Errorf("marshal config fetch for job %s: %w", spec.ID, err)
+	}
+
+	attachables, err := b.sessionAttachables(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	outDir, err := os.MkdirTemp("", "anda-config-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(outDir)
+
+	solveOpt := client.SolveOpt{
+		Session: attachables,
+		Exports: []client.ExportEntry{{Type: client.ExporterLocal, OutputDir: outDir}},
+	}
+
+	if _, err := bkClient.Solve(ctx, def, solveOpt, nil); err != nil {
+		return nil, fmt.Errorf("clone %s for job %s: %w", spec.Repo, spec.ID, err)
+	}
+
+	return LoadFromFile(filepath.Join(outDir, configPath))
+}
+
+// rpmbuildCommand renders the rpmbuild invocation for cfg, translating the
+// macros map to --define flags alongside the fixed _rpmdir/_srcrpmdir setup.
+func (cfg *BuildConfig) rpmbuildCommand() string {
+	var defines strings.Builder
+	for name, value := range cfg.Macros {
+		fmt.Fprintf(&defines, " --define \"%s %s\"", name, value)
+	}
+
+	return fmt.Sprintf(
+		`rpmbuild -ba %s --define "_rpmdir $(pwd)" --define "_srcrpmdir $(pwd)" --undefine=_disable_source_fetch --define '_sourcedir .'%s`,
+		cfg.SpecFile, defines.String(),
+	)
+}
+
+// runAll chains a Run step per command onto state, in order.
+func runAll(state llb.State, cmds ...string) llb.State {
+	for _, cmd := range cmds {
+		state = state.Run(llb.Shlex(cmd)).Root()
+	}
+	return state
+}
+
+// commandSequence renders, in order, every shell command stateFromConfig
+// runs to turn cfg into built RPMs. It is kept separate from stateFromConfig
+// so the composition can be asserted on directly, without marshaling an LLB
+// graph.
+func (cfg *BuildConfig) commandSequence() []string {
+	var cmds []string
+
+	for _, repo := range cfg.BuilddepRepos {
+		cmds = append(cmds, fmt.Sprintf("dnf copr enable -y %s", repo))
+	}
+
+	for _, src := range cfg.Sources {
+		// rpmbuildCommand pins _sourcedir to ".", so extra sources must
+		// land next to the spec file rather than in a SOURCES/ subdir.
+		cmds = append(cmds, fmt.Sprintf("curl -fsSL -o %s %s", filepath.Base(src), src))
+	}
+
+	for _, patch := range cfg.Patches {
+		cmds = append(cmds, fmt.Sprintf("patch -p1 < %s", patch))
+	}
+
+	cmds = append(cmds, cfg.Pre...)
+
+	cmds = append(cmds,
+		fmt.Sprintf("dnf builddep -y %s", cfg.SpecFile),
+		"rpmdev-setuptree",
+		cfg.rpmbuildCommand(),
+	)
+
+	return append(cmds, cfg.Post...)
+}
+
+// stateFromConfig composes the RPM build pipeline described by cfg onto the
+// cloned-and-toolchain-installed base state, replacing the hardcoded
+// dnf builddep/rpmbuild sequence with whatever the package's .anda.yml asks
+// for.
+func (b *BuilderService) stateFromConfig(base llb.State, cfg *BuildConfig) llb.State {
+	return runAll(base, cfg.commandSequence()...)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRpmbuildCommand(t *testing.T) {
+	cfg := &BuildConfig{
+		SpecFile: "package.spec",
+		Macros: map[string]string{
+			"_without_tests": "1",
+		},
+	}
+
+	cmd := cfg.rpmbuildCommand()
+
+	for _, want := range []string{
+		"rpmbuild -ba package.spec",
+		`--define "_rpmdir $(pwd)"`,
+		`--define "_srcrpmdir $(pwd)"`,
+		`--define "_without_tests 1"`,
+	} {
+		if !strings.Contains(cmd, want) {
+			t.Errorf("rpmbuildCommand() = %q, want substring %q", cmd, want)
+		}
+	}
+}
+
+func TestCommandSequence(t *testing.T) {
+	cfg := &BuildConfig{
+		SpecFile:      "package.spec",
+		BuilddepRepos: []string{"@copr/example"},
+		Sources:       []string{"https://example.com/extra-1.0.tar.gz"},
+		Patches:       []string{"fix-build.patch"},
+		Pre:           []string{"echo pre"},
+		Post:          []string{"echo post"},
+	}
+
+	cmds := cfg.commandSequence()
+
+	want := []string{
+		"dnf copr enable -y @copr/example",
+		"curl -fsSL -o extra-1.0.tar.gz https://example.com/extra-1.0.tar.gz",
+		"patch -p1 < fix-build.patch",
+		"echo pre",
+		"dnf builddep -y package.spec",
+		"rpmdev-setuptree",
+		cfg.rpmbuildCommand(),
+		"echo post",
+	}
+
+	if !reflect.DeepEqual(cmds, want) {
+		t.Errorf("commandSequence() = %v, want %v", cmds, want)
+	}
+
+	for _, cmd := range cmds {
+		if strings.Contains(cmd, "SOURCES/") {
+			t.Errorf("commandSequence() referenced SOURCES/, but rpmbuildCommand pins _sourcedir to %q", ".")
+		}
+	}
+}
+
+func TestRpmbuildCommandNoMacros(t *testing.T) {
+	cfg := &BuildConfig{SpecFile: "other.spec"}
+
+	cmd := cfg.rpmbuildCommand()
+
+	if !strings.HasPrefix(cmd, "rpmbuild -ba other.spec ") {
+		t.Errorf("rpmbuildCommand() = %q, want prefix %q", cmd, "rpmbuild -ba other.spec ")
+	}
+	if strings.Contains(cmd, "--define \"\"") {
+		t.Errorf("rpmbuildCommand() = %q, emitted an empty --define", cmd)
+	}
+}
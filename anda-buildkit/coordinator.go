@@ -0,0 +1,546 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// JobState is the lifecycle state of a queued build.
+type JobState string
+
+const (
+	JobPending   JobState = "pending"
+	JobAssigned  JobState = "assigned"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+)
+
+// Worker is a registered BuildKit endpoint the Coordinator can dispatch jobs
+// to, tagged with the capabilities (arch, RAM, "mock-capable", etc.) the
+// scheduler matches jobs against.
+type Worker struct {
+	ID           string   `json:"id"`
+	BuildkitAddr string   `json:"buildkitAddr"`
+	Tags         []string `json:"tags"`
+}
+
+// Job is a submitted JobSpec plus its scheduling state, persisted in the job
+// queue so it survives a coordinator restart.
+type Job struct {
+	ID        string    `json:"id"`
+	Spec      JobSpec   `json:"spec"`
+	Tags      []string  `json:"tags"`
+	State     JobState  `json:"state"`
+	WorkerID  string    `json:"workerId,omitempty"`
+	Attempts  int       `json:"attempts"`
+	Err       string    `json:"err,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// logChunk is one piece of stdout/stderr output persisted for a job so
+// builder_tail can resume streaming after a client reconnects.
+type logChunk struct {
+	Stream string `json:"stream"`
+	Data   []byte `json:"data"`
+}
+
+var (
+	jobsBucket = []byte("jobs")
+	logsBucket = []byte("logs")
+)
+
+// jobQueue is a bbolt-backed durable queue of Jobs and their log chunks.
+type jobQueue struct {
+	db *bbolt.DB
+}
+
+func newJobQueue(path string) (*jobQueue, error) {
+	db, err := bbolt.Open(path, 0o600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("open job queue %q: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(jobsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(logsBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("init job queue %q: %w", path, err)
+	}
+
+	return &jobQueue{db: db}, nil
+}
+
+func (q *jobQueue) put(job *Job) error {
+	return q.db.Update(func(tx *bbolt.Tx) error {
+		data, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(jobsBucket).Put([]byte(job.ID), data)
+	})
+}
+
+// update atomically reads the job with id and applies mutate to it within a
+// single bbolt transaction, persisting the result unless mutate returns
+// false. This closes the read-then-write gap a separate get+put pair would
+// leave open, so a concurrent update (e.g. Cancel marking a job canceled)
+// can't be silently clobbered by one that read the job before it landed.
+func (q *jobQueue) update(id string, mutate func(*Job) bool) (*Job, error) {
+	var job Job
+
+	err := q.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(jobsBucket)
+
+		data := b.Get([]byte(id))
+		if data == nil {
+			return fmt.Errorf("job %q not found", id)
+		}
+		if err := json.Unmarshal(data, &job); err != nil {
+			return err
+		}
+
+		if !mutate(&job) {
+			return nil
+		}
+
+		updated, err := json.Marshal(&job)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (q *jobQueue) get(id string) (*Job, error) {
+	var job Job
+	err := q.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(id))
+		if data == nil {
+			return fmt.Errorf("job %q not found", id)
+		}
+		return json.Unmarshal(data, &job)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (q *jobQueue) list(filter func(*Job) bool) ([]*Job, error) {
+	var jobs []*Job
+
+	err := q.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(_, data []byte) error {
+			var job Job
+			if err := json.Unmarshal(data, &job); err != nil {
+				return err
+			}
+			if filter == nil || filter(&job) {
+				jobs = append(jobs, &job)
+			}
+			return nil
+		})
+	})
+
+	return jobs, err
+}
+
+func (q *jobQueue) appendLog(jobID string, chunk logChunk) error {
+	return q.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(logsBucket)
+
+		var chunks []logChunk
+		if data := b.Get([]byte(jobID)); data != nil {
+			if err := json.Unmarshal(data, &chunks); err != nil {
+				return err
+			}
+		}
+		chunks = append(chunks, chunk)
+
+		data, err := json.Marshal(chunks)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(jobID), data)
+	})
+}
+
+func (q *jobQueue) tail(jobID string, offset int) ([]logChunk, error) {
+	var chunks []logChunk
+
+	err := q.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(logsBucket).Get([]byte(jobID))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &chunks)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if offset >= len(chunks) {
+		return nil, nil
+	}
+
+	return chunks[offset:], nil
+}
+
+// jobBuilder is the slice of BuilderService the Coordinator drives; a narrow
+// interface so tests can exercise the scheduler/cancel logic against a fake
+// without a live buildkitd.
+type jobBuilder interface {
+	Build(ctx context.Context, spec JobSpec, listener BuildListener) map[string]error
+}
+
+// Coordinator turns BuilderService into a multi-worker, durable job queue:
+// it registers BuildKit endpoints by capability tag, keeps queued jobs in a
+// jobQueue across pending->assigned->running->succeeded/failed, and runs a
+// scheduler goroutine that matches jobs to idle workers and retries
+// transient failures with backoff.
+type Coordinator struct {
+	builder jobBuilder
+	queue   *jobQueue
+
+	mu      sync.Mutex
+	workers map[string]*Worker
+	busy    map[string]bool
+
+	wake chan struct{}
+}
+
+// NewCoordinator opens the durable job queue at queuePath and starts the
+// scheduler loop, dispatching accepted jobs through builder.
+func NewCoordinator(builder *BuilderService, queuePath string) (*Coordinator, error) {
+	queue, err := newJobQueue(queuePath)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Coordinator{
+		builder: builder,
+		queue:   queue,
+		workers: make(map[string]*Worker),
+		busy:    make(map[string]bool),
+		wake:    make(chan struct{}, 1),
+	}
+
+	go c.schedule()
+
+	return c, nil
+}
+
+// RegisterWorker adds w to the pool of BuildKit endpoints the scheduler can
+// dispatch jobs to.
+func (c *Coordinator) RegisterWorker(w Worker) error {
+	if w.ID == "" {
+		return fmt.Errorf("register worker: id must not be empty")
+	}
+
+	c.mu.Lock()
+	c.workers[w.ID] = &w
+	c.mu.Unlock()
+
+	c.poke()
+	return nil
+}
+
+// Submit enqueues spec, to be matched against idle workers whose tags are a
+// superset of tags, and returns its job ID without waiting for it to run.
+func (c *Coordinator) Submit(spec JobSpec, tags []string) (string, error) {
+	if spec.ID == "" {
+		return "", fmt.Errorf("submit: spec.ID must not be empty")
+	}
+
+	job := &Job{
+		ID:        spec.ID,
+		Spec:      spec,
+		Tags:      tags,
+		State:     JobPending,
+		UpdatedAt: time.Now(),
+	}
+
+	if err := c.queue.put(job); err != nil {
+		return "", err
+	}
+
+	c.poke()
+	return job.ID, nil
+}
+
+// Status returns the current state of a previously submitted job.
+func (c *Coordinator) Status(jobID string) (*Job, error) {
+	return c.queue.get(jobID)
+}
+
+// List returns every job in state, or every job if state is "".
+func (c *Coordinator) List(state JobState) ([]*Job, error) {
+	var filter func(*Job) bool
+	if state != "" {
+		filter = func(j *Job) bool { return j.State == state }
+	}
+
+	return c.queue.list(filter)
+}
+
+// Cancel marks a pending or assigned job failed so the scheduler skips it; a
+// job already running on a worker still finishes, but its result is ignored.
+func (c *Coordinator) Cancel(jobID string) error {
+	_, err := c.queue.update(jobID, func(job *Job) bool {
+		if job.State == JobSucceeded || job.State == JobFailed {
+			return false
+		}
+
+		job.State = JobFailed
+		job.Err = "canceled"
+		job.UpdatedAt = time.Now()
+		return true
+	})
+	return err
+}
+
+// Tail resumes log streaming for jobID from offset, for a client that
+// reconnected mid-build.
+func (c *Coordinator) Tail(jobID string, offset int) ([]logChunk, error) {
+	return c.queue.tail(jobID, offset)
+}
+
+func (c *Coordinator) poke() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// schedule matches queued jobs to idle workers by tag until the coordinator
+// is closed.
+func (c *Coordinator) schedule() {
+	for range c.wake {
+		c.dispatchReady()
+	}
+}
+
+func (c *Coordinator) dispatchReady() {
+	jobs, err := c.queue.list(func(j *Job) bool { return j.State == JobPending })
+	if err != nil {
+		return
+	}
+
+	for _, job := range jobs {
+		worker := c.claimWorker(job.Tags)
+		if worker == nil {
+			continue
+		}
+
+		job.State = JobAssigned
+		job.WorkerID = worker.ID
+		job.UpdatedAt = time.Now()
+		c.queue.put(job)
+
+		go c.run(job, worker)
+	}
+}
+
+// claimWorker picks an idle worker whose tags are a superset of required,
+// marking it busy.
+func (c *Coordinator) claimWorker(required []string) *Worker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, w := range c.workers {
+		if c.busy[id] || !hasAllTags(w.Tags, required) {
+			continue
+		}
+		c.busy[id] = true
+		return w
+	}
+
+	return nil
+}
+
+func (c *Coordinator) releaseWorker(id string) {
+	c.mu.Lock()
+	c.busy[id] = false
+	c.mu.Unlock()
+
+	c.poke()
+}
+
+func hasAllTags(have, want []string) bool {
+	set := make(map[string]bool, len(have))
+	for _, t := range have {
+		set[t] = true
+	}
+
+	for _, t := range want {
+		if !set[t] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// run drives job to completion on worker, retrying transient failures with
+// exponential backoff, and persists its final state and log chunks.
+func (c *Coordinator) run(job *Job, worker *Worker) {
+	defer c.releaseWorker(worker.ID)
+
+	spec := job.Spec
+	spec.BuildkitAddr = worker.BuildkitAddr
+
+	const maxAttempts = 3
+	backoff := time.Second
+
+	listener := &queueListener{queue: c.queue}
+
+	if !c.transitionUnlessCanceled(job.ID, func(j *Job) {
+		j.State = JobRunning
+		j.UpdatedAt = time.Now()
+	}) {
+		return
+	}
+
+	var lastErr error
+	for job.Attempts = 1; job.Attempts <= maxAttempts; job.Attempts++ {
+		lastErr = firstError(c.builder.Build(context.Background(), spec, listener))
+		if lastErr == nil {
+			break
+		}
+
+		if c.canceled(job.ID) {
+			return
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	attempts, finalErr := job.Attempts, lastErr
+	c.transitionUnlessCanceled(job.ID, func(j *Job) {
+		j.Attempts = attempts
+		if finalErr != nil {
+			j.State = JobFailed
+			j.Err = finalErr.Error()
+		} else {
+			j.State = JobSucceeded
+			j.Err = ""
+		}
+		j.UpdatedAt = time.Now()
+	})
+}
+
+// canceled reports whether jobID has been marked canceled (JobFailed with
+// Err "canceled") since run started, so a build that's about to retry after
+// a concurrent Cancel doesn't keep going.
+func (c *Coordinator) canceled(jobID string) bool {
+	current, err := c.queue.get(jobID)
+	if err != nil {
+		return false
+	}
+
+	return isCanceled(current)
+}
+
+// isCanceled reports whether job has been marked canceled by Cancel.
+func isCanceled(job *Job) bool {
+	return job.State == JobFailed && job.Err == "canceled"
+}
+
+// transitionUnlessCanceled atomically applies mutate to the job with id
+// unless it has already been marked canceled, closing the gap a separate
+// canceled-check-then-put pair would leave open for a concurrent Cancel to
+// land in between and be clobbered by run's own state write. It reports
+// whether mutate was applied.
+func (c *Coordinator) transitionUnlessCanceled(jobID string, mutate func(*Job)) bool {
+	applied := false
+
+	_, err := c.queue.update(jobID, func(job *Job) bool {
+		if isCanceled(job) {
+			return false
+		}
+		mutate(job)
+		applied = true
+		return true
+	})
+
+	return err == nil && applied
+}
+
+func firstError(errs map[string]error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueListener persists stdout/stderr chunks to the job queue so
+// builder_tail can resume streaming after a client reconnects. It is keyed
+// per call by the jobID BuildListener hands it, which for a multi-arch job
+// is "<spec.ID>-<arch>" (see buildArch), so per-arch output stays separate.
+type queueListener struct {
+	queue *jobQueue
+}
+
+func (l *queueListener) OnJobStdout(jobID string, chunk []byte) {
+	l.queue.appendLog(jobID, logChunk{Stream: "stdout", Data: chunk})
+}
+
+func (l *queueListener) OnJobStderr(jobID string, chunk []byte) {
+	l.queue.appendLog(jobID, logChunk{Stream: "stderr", Data: chunk})
+}
+
+func (l *queueListener) OnJobFinished(jobID string) {}
+
+func (l *queueListener) OnJobFailed(jobID string, code int, err error) {}
+
+func (l *queueListener) OnArtifactPublished(jobID string, artifact string, err error) {}
+
+// RegisterWorker implements the builder_registerWorker RPC.
+func (b *BuilderService) RegisterWorker(w Worker) error {
+	return b.coordinator.RegisterWorker(w)
+}
+
+// Submit implements the builder_submit RPC.
+func (b *BuilderService) Submit(spec JobSpec, tags []string) (string, error) {
+	return b.coordinator.Submit(spec, tags)
+}
+
+// Status implements the builder_status RPC.
+func (b *BuilderService) Status(jobID string) (*Job, error) {
+	return b.coordinator.Status(jobID)
+}
+
+// Cancel implements the builder_cancel RPC.
+func (b *BuilderService) Cancel(jobID string) error {
+	return b.coordinator.Cancel(jobID)
+}
+
+// List implements the builder_list RPC.
+func (b *BuilderService) List(state JobState) ([]*Job, error) {
+	return b.coordinator.List(state)
+}
+
+// Tail implements the builder_tail RPC.
+func (b *BuilderService) Tail(jobID string, offset int) ([]logChunk, error) {
+	return b.coordinator.Tail(jobID, offset)
+}
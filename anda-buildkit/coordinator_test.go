@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// fakeBuilder is a jobBuilder whose Build blocks until unblock is closed,
+// then returns result, so tests can pin down exactly when a job is "running"
+// and drive a concurrent Cancel into that window.
+type fakeBuilder struct {
+	started chan struct{}
+	unblock chan struct{}
+	result  map[string]error
+}
+
+func (f *fakeBuilder) Build(ctx context.Context, spec JobSpec, listener BuildListener) map[string]error {
+	close(f.started)
+	<-f.unblock
+	return f.result
+}
+
+func newTestCoordinator(t *testing.T, builder jobBuilder) *Coordinator {
+	t.Helper()
+
+	return &Coordinator{
+		builder: builder,
+		queue:   newTestQueue(t),
+		workers: make(map[string]*Worker),
+		busy:    make(map[string]bool),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+func TestHasAllTags(t *testing.T) {
+	cases := []struct {
+		name string
+		have []string
+		want []string
+		ok   bool
+	}{
+		{name: "empty want always satisfied", have: []string{"amd64"}, want: nil, ok: true},
+		{name: "want subset of have", have: []string{"amd64", "mock-capable"}, want: []string{"amd64"}, ok: true},
+		{name: "want equals have", have: []string{"amd64"}, want: []string{"amd64"}, ok: true},
+		{name: "want has tag have lacks", have: []string{"amd64"}, want: []string{"amd64", "arm64"}, ok: false},
+		{name: "have empty, want non-empty", have: nil, want: []string{"amd64"}, ok: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := hasAllTags(tc.have, tc.want); got != tc.ok {
+				t.Errorf("hasAllTags(%v, %v) = %v, want %v", tc.have, tc.want, got, tc.ok)
+			}
+		})
+	}
+}
+
+func newTestQueue(t *testing.T) *jobQueue {
+	t.Helper()
+
+	q, err := newJobQueue(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatalf("newJobQueue: %v", err)
+	}
+	t.Cleanup(func() { q.db.Close() })
+
+	return q
+}
+
+func TestJobQueuePutGet(t *testing.T) {
+	q := newTestQueue(t)
+
+	job := &Job{ID: "job-1", State: JobPending}
+	if err := q.put(job); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	got, err := q.get("job-1")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.ID != job.ID || got.State != job.State {
+		t.Errorf("get returned %+v, want %+v", got, job)
+	}
+
+	if _, err := q.get("missing"); err == nil {
+		t.Fatal("get(missing): want error, got nil")
+	}
+}
+
+func TestJobQueueList(t *testing.T) {
+	q := newTestQueue(t)
+
+	jobs := []*Job{
+		{ID: "job-1", State: JobPending},
+		{ID: "job-2", State: JobRunning},
+		{ID: "job-3", State: JobPending},
+	}
+	for _, j := range jobs {
+		if err := q.put(j); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+	}
+
+	all, err := q.list(nil)
+	if err != nil {
+		t.Fatalf("list(nil): %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("list(nil) returned %d jobs, want 3", len(all))
+	}
+
+	pending, err := q.list(func(j *Job) bool { return j.State == JobPending })
+	if err != nil {
+		t.Fatalf("list(pending): %v", err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("list(pending) returned %d jobs, want 2", len(pending))
+	}
+}
+
+func TestJobQueueAppendLogAndTail(t *testing.T) {
+	q := newTestQueue(t)
+
+	if err := q.appendLog("job-1", logChunk{Stream: "stdout", Data: []byte("a")}); err != nil {
+		t.Fatalf("appendLog: %v", err)
+	}
+	if err := q.appendLog("job-1", logChunk{Stream: "stdout", Data: []byte("b")}); err != nil {
+		t.Fatalf("appendLog: %v", err)
+	}
+	if err := q.appendLog("job-2", logChunk{Stream: "stderr", Data: []byte("other")}); err != nil {
+		t.Fatalf("appendLog: %v", err)
+	}
+
+	chunks, err := q.tail("job-1", 0)
+	if err != nil {
+		t.Fatalf("tail: %v", err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("tail(job-1, 0) returned %d chunks, want 2", len(chunks))
+	}
+
+	chunks, err = q.tail("job-1", 1)
+	if err != nil {
+		t.Fatalf("tail: %v", err)
+	}
+	if len(chunks) != 1 || string(chunks[0].Data) != "b" {
+		t.Fatalf("tail(job-1, 1) = %+v, want one chunk with data %q", chunks, "b")
+	}
+
+	chunks, err = q.tail("job-1", 2)
+	if err != nil {
+		t.Fatalf("tail: %v", err)
+	}
+	if len(chunks) != 0 {
+		t.Fatalf("tail(job-1, 2) returned %d chunks, want 0", len(chunks))
+	}
+
+	chunks, err = q.tail("no-such-job", 0)
+	if err != nil {
+		t.Fatalf("tail: %v", err)
+	}
+	if len(chunks) != 0 {
+		t.Fatalf("tail(no-such-job, 0) returned %d chunks, want 0", len(chunks))
+	}
+}
+
+// TestRunSkipsCanceledJobBeforeStart covers the gap between run's canceled
+// check and its Running write: a Cancel that lands before run is ever
+// invoked must not be clobbered by run unconditionally transitioning the
+// job to Running.
+func TestRunSkipsCanceledJobBeforeStart(t *testing.T) {
+	builder := &fakeBuilder{started: make(chan struct{}), unblock: make(chan struct{})}
+	c := newTestCoordinator(t, builder)
+
+	job := &Job{ID: "job-1", State: JobAssigned}
+	if err := c.queue.put(job); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if err := c.Cancel(job.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+
+	close(builder.unblock) // run must never reach Build; unblock it anyway so a bug doesn't hang the test.
+	c.run(job, &Worker{ID: "w1"})
+
+	got, err := c.queue.get(job.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.State != JobFailed || got.Err != "canceled" {
+		t.Errorf("run() on a pre-canceled job persisted %+v, want State=%s Err=%q", got, JobFailed, "canceled")
+	}
+}
+
+// TestRunCancelDuringBuildPreservesCancellation drives a Cancel while a job
+// is actually running on a worker, then lets the build succeed, and asserts
+// the canceled state survives rather than being overwritten by run's
+// own success write.
+func TestRunCancelDuringBuildPreservesCancellation(t *testing.T) {
+	builder := &fakeBuilder{
+		started: make(chan struct{}),
+		unblock: make(chan struct{}),
+		result:  nil, // nil map == every arch succeeded
+	}
+	c := newTestCoordinator(t, builder)
+
+	job := &Job{ID: "job-1", State: JobAssigned}
+	if err := c.queue.put(job); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.run(job, &Worker{ID: "w1"})
+		close(done)
+	}()
+
+	<-builder.started // job is now persisted as Running and mid-build
+
+	if err := c.Cancel(job.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	close(builder.unblock) // let the build "succeed"
+
+	<-done
+
+	got, err := c.queue.get(job.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got.State != JobFailed || got.Err != "canceled" {
+		t.Errorf("run() overwrote a cancellation with %+v, want State=%s Err=%q", got, JobFailed, "canceled")
+	}
+}
@@ -3,44 +3,133 @@ package main
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"net/http"
 
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/moby/buildkit/client/llb"
 )
 
-type BuilderService struct{}
+type BuilderService struct {
+	secrets secretStore
+
+	// coordinator fans JobSpecs submitted via Submit out across the
+	// registered Workers. Set by main before the RPC server starts.
+	coordinator *Coordinator
+}
 
 type JobSpec struct {
 	ID      string `json:"id"`
 	Repo    string `json:"repo"`
 	Ref     string `json:"ref"`
 	Builder string `json:"builder"`
+
+	// BuildkitAddr is the buildkitd gRPC endpoint to dispatch this job to,
+	// e.g. "tcp://buildkitd:1234" or "unix:///run/buildkit/buildkitd.sock".
+	BuildkitAddr string `json:"buildkitAddr"`
+
+	// ConfigPath is the path to an .anda.yml build spec inside the cloned
+	// repo. When set, it drives the build pipeline instead of the fixed
+	// dnf builddep/rpmbuild sequence.
+	ConfigPath string `json:"configPath"`
+
+	// Architectures is the build matrix for this job, e.g.
+	// ["amd64", "arm64", "ppc64le", "s390x"]. Defaults to ["amd64"].
+	Architectures []string `json:"architectures"`
+
+	// Auth authenticates the clone of Repo, for private repositories. Nil
+	// means an unauthenticated clone.
+	Auth *Auth `json:"auth,omitempty"`
+
+	// Sinks lists the repositories built RPMs are replicated to once the
+	// build finishes.
+	Sinks []SinkRef `json:"sinks,omitempty"`
 }
 
-func (b *BuilderService) JobLLB(spec JobSpec) (string, error) {
-	state := llb.Image(spec.Builder).Run(llb.Shlex("echo hello!")).
-		AddMount("/src", llb.Git(spec.Repo, spec.Ref)).
+// jobPlan is the resolved LLB graph for a JobSpec, plus the architecture
+// matrix and artifact glob->destination map that drive it -- either the
+// fixed defaults, or, when spec.ConfigPath is set, whatever the package's
+// own .anda.yml asks for.
+type jobPlan struct {
+	state     llb.State
+	archs     []string
+	artifacts map[string]string
+}
+
+// plan assembles the LLB graph for spec: clone the repo, install the RPM
+// toolchain, and run rpmbuild against the package spec in-tree.
+func (b *BuilderService) plan(ctx context.Context, spec JobSpec) (jobPlan, error) {
+	base := llb.Image(spec.Builder).Run(llb.Shlex("echo hello!")).
+		AddMount("/src", llb.Git(spec.Repo, spec.Ref, spec.gitOptions()...)).
 		Dir("/src").
-		Run(llb.Shlex("dnf install -y rpmdevtools rpmbuild dnf-plugins-core")).
-		Run(llb.Shlex("dnf builddep -y package.spec")).
-		Run(llb.Shlex("rpmdev-setuptree")).
-		Run(llb.Shlex("rpmbuild -ba package.spec -define \"_rpmdir $(pwd)\" --define \"_srcrpmdir $(pwd)\" --undefine=_disable_source_fetch --define '_sourcedir .'"))
+		Run(llb.Shlex("dnf install -y rpmdevtools rpmbuild dnf-plugins-core")).Root()
+
+	if spec.ConfigPath == "" {
+		state := runAll(base,
+			"dnf builddep -y package.spec",
+			"rpmdev-setuptree",
+			`rpmbuild -ba package.spec -define "_rpmdir $(pwd)" --define "_srcrpmdir $(pwd)" --undefine=_disable_source_fetch --define '_sourcedir .'`,
+		)
+		return jobPlan{state: state, archs: spec.archs()}, nil
+	}
 
-	bc, err := state.Root().Marshal(context.TODO(), llb.LinuxAmd64)
+	cfg, err := b.LoadFromRepo(ctx, spec, spec.ConfigPath)
 	if err != nil {
-		return "", err
+		return jobPlan{}, fmt.Errorf("job %s: %w", spec.ID, err)
 	}
 
-	var buf bytes.Buffer
+	// spec.Architectures, when the caller set it explicitly, always wins
+	// over the package's own arch_matrix.
+	archs := spec.archs()
+	if len(spec.Architectures) == 0 && len(cfg.ArchMatrix) > 0 {
+		archs = cfg.ArchMatrix
+	}
 
-	llb.WriteTo(bc, &buf)
+	return jobPlan{
+		state:     b.stateFromConfig(base, cfg),
+		archs:     archs,
+		artifacts: cfg.Artifacts,
+	}, nil
+}
 
-	return buf.String(), nil
+// JobLLB marshals one LLB graph per entry in the resolved architecture
+// matrix, returning them keyed by arch so callers can inspect or cache
+// per-arch definitions.
+func (b *BuilderService) JobLLB(ctx context.Context, spec JobSpec) (map[string]string, error) {
+	p, err := b.plan(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]string, len(p.archs))
+	for _, arch := range p.archs {
+		opt, ok := archConstraint[arch]
+		if !ok {
+			return nil, fmt.Errorf("job %s: unsupported architecture %q", spec.ID, arch)
+		}
+
+		bc, err := p.state.Marshal(ctx, opt)
+		if err != nil {
+			return nil, fmt.Errorf("job %s (%s): %w", spec.ID, arch, err)
+		}
+
+		var buf bytes.Buffer
+		llb.WriteTo(bc, &buf)
+		out[arch] = buf.String()
+	}
+
+	return out, nil
 }
 
 func main() {
 	builder := new(BuilderService)
+
+	coordinator, err := NewCoordinator(builder, "anda-builder.db")
+	if err != nil {
+		panic(err)
+	}
+	builder.coordinator = coordinator
+
 	server := rpc.NewServer()
 	server.RegisterName("builder", builder)
 